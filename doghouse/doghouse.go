@@ -0,0 +1,43 @@
+// Package doghouse defines the request/response types exchanged between a
+// reviewdog client and the doghouse server, which runs lint checks against a
+// GitHub pull request on the client's behalf and reports results as a Check
+// Run.
+package doghouse
+
+import "github.com/reviewdog/reviewdog"
+
+// CheckRequest represents a request to the doghouse server to run a check
+// against a pull request.
+type CheckRequest struct {
+	// Name of the check. It's visible on GitHub as the Check Run name.
+	Name        string
+	Owner       string
+	Repo        string
+	PullRequest int
+	SHA         string
+
+	// Annotations are the findings to report, produced by the caller's lint
+	// run.
+	Annotations []*Annotation
+
+	// Level is the annotation level reported to GitHub (e.g. "warning",
+	// "failure").
+	Level string
+}
+
+// Annotation represents a single lint finding.
+type Annotation struct {
+	Path       string
+	Line       int
+	Message    string
+	RawMessage string
+}
+
+// CheckResponse is the result of running a CheckRequest.
+type CheckResponse struct {
+	// ReportURL is the URL of the created Check Run.
+	ReportURL string
+	// CheckedResults are the findings that were considered, annotated with
+	// whether they fall within the diff.
+	CheckedResults []*reviewdog.FilteredCheck
+}
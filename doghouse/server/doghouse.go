@@ -0,0 +1,117 @@
+// Package server implements the doghouse server, which runs on behalf of a
+// reviewdog client to check a GitHub pull request and report findings as a
+// Check Run.
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v28/github"
+	"github.com/reviewdog/reviewdog"
+	"github.com/reviewdog/reviewdog/diff"
+	"github.com/reviewdog/reviewdog/difffilter"
+	"github.com/reviewdog/reviewdog/doghouse"
+	rdferrors "github.com/reviewdog/reviewdog/errors"
+)
+
+// checkerGitHubClientInterface is the subset of the GitHub API Checker
+// needs, so that tests can fake it.
+type checkerGitHubClientInterface interface {
+	GetPullRequestDiff(ctx context.Context, owner, repo string, number int) ([]byte, error)
+	CreateCheckRun(ctx context.Context, owner, repo string, opt github.CreateCheckRunOptions) (*github.CheckRun, error)
+}
+
+// Checker runs a single doghouse.CheckRequest and reports it as a Check Run.
+type Checker struct {
+	req *doghouse.CheckRequest
+	gh  checkerGitHubClientInterface
+}
+
+// NewChecker returns a new Checker for req.
+func NewChecker(req *doghouse.CheckRequest, gh checkerGitHubClientInterface) *Checker {
+	return &Checker{req: req, gh: gh}
+}
+
+// Check runs the check and reports it as a GitHub Check Run. If GitHub
+// refuses to create the Check Run because of a permission problem (e.g. the
+// app isn't installed, or branch protection blocks it), Check reports the
+// checked results without an error so the caller can still inspect them.
+func (ch *Checker) Check(ctx context.Context) (*doghouse.CheckResponse, error) {
+	req := ch.req
+	diffBytes, err := ch.gh.GetPullRequestDiff(ctx, req.Owner, req.Repo, req.PullRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diff: %v", err)
+	}
+	filediffs, err := diff.ParseMultiFile(strings.NewReader(string(diffBytes)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse diff: %v", err)
+	}
+
+	results := make([]*reviewdog.CheckResult, 0, len(req.Annotations))
+	for _, a := range req.Annotations {
+		results = append(results, &reviewdog.CheckResult{
+			Path:    a.Path,
+			Lnum:    a.Line,
+			Message: a.Message,
+		})
+	}
+	filtered := reviewdog.FilterCheck(results, filediffs, 1, "", difffilter.ModeAdded)
+	if filtered == nil {
+		filtered = []*reviewdog.FilteredCheck{}
+	}
+
+	level := req.Level
+	if level == "" {
+		level = "warning"
+	}
+	var annotations []*github.CheckRunAnnotation
+	for i, fc := range filtered {
+		if !fc.InDiff {
+			continue
+		}
+		a := req.Annotations[i]
+		annotations = append(annotations, &github.CheckRunAnnotation{
+			Path:            github.String(fc.CheckResult.Path),
+			StartLine:       github.Int(fc.CheckResult.Lnum),
+			EndLine:         github.Int(fc.CheckResult.Lnum),
+			AnnotationLevel: github.String(level),
+			Message:         github.String(fc.CheckResult.Message),
+			Title:           github.String(fmt.Sprintf("[%s] %s#L%d", req.Name, fc.CheckResult.Path, fc.CheckResult.Lnum)),
+			RawDetails:      github.String(a.RawMessage),
+		})
+	}
+
+	conclusion := "success"
+	if len(annotations) > 0 {
+		conclusion = "neutral"
+	}
+
+	run, err := ch.gh.CreateCheckRun(ctx, req.Owner, req.Repo, github.CreateCheckRunOptions{
+		Name:       req.Name,
+		HeadSHA:    req.SHA,
+		Conclusion: github.String(conclusion),
+		Output: &github.CheckRunOutput{
+			Title:       github.String(req.Name),
+			Summary:     github.String(fmt.Sprintf("reported %d finding(s)", len(annotations))),
+			Annotations: annotations,
+		},
+	})
+	if err != nil {
+		switch rdferrors.FromGitHubError(err).(type) {
+		case *rdferrors.UserError:
+			// The app doesn't have permission to create a Check Run (e.g. not
+			// installed, or branch protection). Report what we checked without
+			// failing the caller's run.
+			return &doghouse.CheckResponse{CheckedResults: filtered}, nil
+		default:
+			return nil, fmt.Errorf("failed to create check run: %v", err)
+		}
+	}
+
+	return &doghouse.CheckResponse{
+		ReportURL:      run.GetHTMLURL(),
+		CheckedResults: filtered,
+	}, nil
+}
@@ -0,0 +1,96 @@
+// Package errors provides typed error categories for reviewdog's comment
+// services. Classifying an upstream error into a category up front lets
+// callers (cmd/reviewdog, the doghouse server) decide exit codes, logging
+// verbosity and retry/backoff policy uniformly, instead of repeating
+// `if statusCode == 403` checks at every call site.
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v28/github"
+)
+
+// UserError represents a problem the user can fix: a missing permission, a
+// branch protection rule, or an invalid token. It is not worth retrying.
+type UserError struct {
+	Err error
+}
+
+func (e *UserError) Error() string { return e.Err.Error() }
+func (e *UserError) Unwrap() error { return e.Err }
+
+// TooManyRequestsError represents GitHub's abuse detection mechanism or a
+// secondary rate limit. Callers should back off, optionally for RetryAfter,
+// and retry.
+type TooManyRequestsError struct {
+	Err error
+	// RetryAfter is how long to wait before retrying. It is zero if the
+	// service did not say.
+	RetryAfter time.Duration
+}
+
+func (e *TooManyRequestsError) Error() string { return e.Err.Error() }
+func (e *TooManyRequestsError) Unwrap() error { return e.Err }
+
+// ServiceFault represents a failure on the upstream service's side: a 5xx
+// response or a network error. It is usually worth retrying.
+type ServiceFault struct {
+	Err error
+}
+
+func (e *ServiceFault) Error() string { return e.Err.Error() }
+func (e *ServiceFault) Unwrap() error { return e.Err }
+
+// FromGitHubError classifies err, as returned by a go-github API call, into
+// a UserError, TooManyRequestsError or ServiceFault. err is returned
+// unchanged if it doesn't look like a *github.ErrorResponse, or if its
+// status code doesn't map to any of the three categories.
+func FromGitHubError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var ghErr *github.ErrorResponse
+	if !errors.As(err, &ghErr) || ghErr.Response == nil {
+		return err
+	}
+	switch resp := ghErr.Response; {
+	case resp.StatusCode == http.StatusForbidden && isAbuseDetection(ghErr):
+		return &TooManyRequestsError{Err: err, RetryAfter: retryAfter(resp)}
+	case resp.StatusCode == http.StatusForbidden,
+		resp.StatusCode == http.StatusUnauthorized,
+		resp.StatusCode == http.StatusUnprocessableEntity,
+		resp.StatusCode == http.StatusNotFound:
+		return &UserError{Err: err}
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return &ServiceFault{Err: err}
+	default:
+		return err
+	}
+}
+
+// isAbuseDetection reports whether ghErr was returned because of GitHub's
+// abuse detection mechanism / secondary rate limit rather than a plain
+// permission error.
+// https://developer.github.com/v3/#abuse-rate-limits
+func isAbuseDetection(ghErr *github.ErrorResponse) bool {
+	msg := strings.ToLower(ghErr.Message)
+	return strings.Contains(msg, "abuse") || strings.Contains(msg, "rate limit") ||
+		ghErr.Response.Header.Get("Retry-After") != ""
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	var secs int
+	if _, err := fmt.Sscanf(v, "%d", &secs); err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
@@ -4,22 +4,29 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"math"
+	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/go-github/v28/github"
 	"github.com/reviewdog/reviewdog"
-	"github.com/reviewdog/reviewdog/service/github/githubutils"
+	rdferrors "github.com/reviewdog/reviewdog/errors"
+	"github.com/reviewdog/reviewdog/service/ratelimit"
+	"github.com/reviewdog/reviewdog/service/reporter"
 	"github.com/reviewdog/reviewdog/service/serviceutil"
 )
 
 var _ reviewdog.CommentService = &GitHubPullRequest{}
 var _ reviewdog.DiffService = &GitHubPullRequest{}
+var _ reporter.CommentReporter = &GitHubPullRequest{}
 
-const maxCommentsPerRequest = 25
+// commentsPerReview is how many draft comments go into a single
+// CreateReview call. It only needs to be a comfortable request size:
+// pacing across calls is ratelimit.Limiter's job, not this constant's.
+const commentsPerReview = 30
 
 // GitHubPullRequest is a comment and diff service for GitHub PullRequest.
 //
@@ -36,27 +43,62 @@ type GitHubPullRequest struct {
 	muComments   sync.Mutex
 	postComments []*reviewdog.Comment
 
-	postedcs serviceutil.PostedComments
-
 	// wd is working directory relative to root of repository.
 	wd string
+
+	// checkFallback and fallbackThreshold implement WithCheckAnnotationsFallback.
+	checkFallback     *GitHubPullRequestCheck
+	fallbackThreshold int
+
+	// limiter paces review-creating API calls to stay under GitHub's abuse
+	// detection thresholds.
+	limiter *ratelimit.Limiter
+}
+
+// Option configures optional behavior of GitHubPullRequest.
+type Option func(*GitHubPullRequest)
+
+// WithCheckAnnotationsFallback makes Flush post findings as Check Run
+// annotations through check instead of pull request review comments once
+// the number of findings to report exceeds threshold, so that large lint
+// runs aren't silently capped by GitHub's review-comment abuse rate limit.
+func WithCheckAnnotationsFallback(check *GitHubPullRequestCheck, threshold int) Option {
+	return func(g *GitHubPullRequest) {
+		g.checkFallback = check
+		g.fallbackThreshold = threshold
+	}
+}
+
+// WithRateLimit overrides the default sliding-window limit on review
+// comment posting of ratelimit.DefaultLimit requests per
+// ratelimit.DefaultWindow.
+func WithRateLimit(limit int, window time.Duration) Option {
+	return func(g *GitHubPullRequest) {
+		g.limiter = ratelimit.NewLimiter(limit, window)
+	}
 }
 
 // NewGitHubPullRequest returns a new GitHubPullRequest service.
-// GitHubPullRequest service needs git command in $PATH.
-func NewGitHubPullRequest(cli *github.Client, owner, repo string, pr int, sha string) (*GitHubPullRequest, error) {
-	workDir, err := serviceutil.GitRelWorkdir()
+// GitHubPullRequest service needs git command in $PATH. ctx is used to
+// cancel the underlying git invocation.
+func NewGitHubPullRequest(ctx context.Context, cli *github.Client, owner, repo string, pr int, sha string, opts ...Option) (*GitHubPullRequest, error) {
+	workDir, err := serviceutil.GitRelWorkdir(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("GitHubPullRequest needs 'git' command: %v", err)
 	}
-	return &GitHubPullRequest{
-		cli:   cli,
-		owner: owner,
-		repo:  repo,
-		pr:    pr,
-		sha:   sha,
-		wd:    workDir,
-	}, nil
+	g := &GitHubPullRequest{
+		cli:     cli,
+		owner:   owner,
+		repo:    repo,
+		pr:      pr,
+		sha:     sha,
+		wd:      workDir,
+		limiter: ratelimit.NewLimiter(ratelimit.DefaultLimit, ratelimit.DefaultWindow),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g, nil
 }
 
 // Post accepts a comment and holds it. Flush method actually posts comments to
@@ -69,113 +111,201 @@ func (g *GitHubPullRequest) Post(_ context.Context, c *reviewdog.Comment) error
 	return nil
 }
 
-// Flush posts comments which has not been posted yet.
+// Flush reconciles the comments held by Post against what reviewdog already
+// posted on a previous run, so that re-running reviewdog on the same PR
+// creates, updates and resolves comments instead of accumulating duplicates.
 func (g *GitHubPullRequest) Flush(ctx context.Context) error {
 	g.muComments.Lock()
 	defer g.muComments.Unlock()
 
-	if err := g.setPostedComment(ctx); err != nil {
-		return err
+	if g.checkFallback != nil && len(g.postComments) > g.fallbackThreshold {
+		log.Printf("reviewdog: %d comments exceed the %d review-comment threshold, "+
+			"falling back to check-run annotations", len(g.postComments), g.fallbackThreshold)
+		// g.postComments' Path was already normalized relative to the repo
+		// root by g.Post, so hand them to the fallback via postNormalized
+		// rather than Post, which would join g.wd in a second time.
+		for _, c := range g.postComments {
+			g.checkFallback.postNormalized(c)
+		}
+		return g.checkFallback.Flush(ctx)
 	}
-	return g.postAsReviewComment(ctx)
-}
 
-func (g *GitHubPullRequest) postAsReviewComment(ctx context.Context) error {
-	comments := make([]*github.DraftReviewComment, 0, len(g.postComments))
-	remaining := make([]*reviewdog.Comment, 0)
+	desired := make([]reporter.Comment, 0, len(g.postComments))
 	for _, c := range g.postComments {
-		if g.postedcs.IsPosted(c, c.LnumDiff) {
-			continue
-		}
-		// Only posts maxCommentsPerRequest comments per 1 request to avoid spammy
-		// review comments. An example GitHub error if we don't limit the # of
-		// review comments.
-		//
-		// > 403 You have triggered an abuse detection mechanism and have been
-		// > temporarily blocked from content creation. Please retry your request
-		// > again later.
-		// https://developer.github.com/v3/#abuse-rate-limits
-		if len(comments) >= maxCommentsPerRequest && false { // disable
-			remaining = append(remaining, c)
+		desired = append(desired, reporter.Comment{
+			ToolName: c.ToolName,
+			Path:     c.Path,
+			Line:     c.LnumDiff,
+			Body:     serviceutil.CommentBody(c),
+		})
+	}
+	return reporter.Apply(ctx, g, desired)
+}
+
+// Existing implements reporter.CommentReporter.
+func (g *GitHubPullRequest) Existing(ctx context.Context) ([]reporter.PostedComment, error) {
+	cs, err := g.comment(ctx)
+	if err != nil {
+		return nil, err
+	}
+	posted := make([]reporter.PostedComment, 0, len(cs))
+	for _, c := range cs {
+		if c.Position == nil || c.Path == nil || c.Body == nil || c.ID == nil {
+			// skip resolved comments. Or comments which do not have "path",
+			// "body" nor "id".
 			continue
 		}
-		cbody := serviceutil.CommentBody(c)
+		posted = append(posted, reporter.PostedComment{
+			ID:   strconv.FormatInt(c.GetID(), 10),
+			Body: c.GetBody(),
+		})
+	}
+	return posted, nil
+}
+
+// Create implements reporter.CommentReporter. It posts cs as one or more
+// reviews made up of draft review comments, paced by g.limiter so that
+// reviewdog can post thousands of comments on a monorepo-sized PR without
+// tripping GitHub's abuse detection.
+func (g *GitHubPullRequest) Create(ctx context.Context, cs []reporter.Comment) error {
+	comments := make([]*github.DraftReviewComment, 0, len(cs))
+	for _, c := range cs {
+		c := c
+		body := reporter.Mark(c)
 		comments = append(comments, &github.DraftReviewComment{
 			Path:     &c.Path,
-			Position: &c.LnumDiff,
-			Body:     &cbody,
+			Position: &c.Line,
+			Body:     &body,
 		})
 	}
-
-	return g.postGitHubComments(ctx, comments, 0)
+	return g.postGitHubComments(ctx, comments)
 }
 
-func (g *GitHubPullRequest) remainingCommentsSummary(remaining []*reviewdog.Comment) string {
-	perTool := make(map[string][]*reviewdog.Comment)
-	for _, c := range remaining {
-		perTool[c.ToolName] = append(perTool[c.ToolName], c)
-	}
-	var sb strings.Builder
-	for tool, comments := range perTool {
-		sb.WriteString("Remaining comments which cannot be posted as a review comment to avoid GitHub abuse Rate Limit\n")
-		sb.WriteString(fmt.Sprintf("### %s\n", tool))
-		for _, c := range comments {
-			sb.WriteString(githubutils.LinkedMarkdownCheckResult(g.owner, g.repo, g.sha, c.CheckResult))
-			sb.WriteString("\n")
-		}
+// Update implements reporter.CommentReporter by editing the previously
+// posted comment's body in place.
+func (g *GitHubPullRequest) Update(ctx context.Context, posted reporter.PostedComment, c reporter.Comment) error {
+	id, err := strconv.ParseInt(posted.ID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid GitHub review comment id %q: %v", posted.ID, err)
 	}
-	return sb.String()
+	body := reporter.Mark(c)
+	_, _, err = g.cli.PullRequests.EditComment(ctx, g.owner, g.repo, id, &github.PullRequestComment{Body: &body})
+	return err
 }
 
-func (g *GitHubPullRequest) postGitHubComments(ctx context.Context, comments []*github.DraftReviewComment, cnt int) error {
-	if len(comments) == 0 {
+// resolvedBodyPrefix marks a comment body Resolve has already rewritten, so
+// a later run recognizes it and skips re-resolving an already-resolved
+// comment every time the finding stays absent.
+const resolvedBodyPrefix = ":white_check_mark: ~~"
+
+// Resolve implements reporter.CommentReporter. The GitHub REST API has no
+// endpoint to resolve or minimize a single review comment thread (that
+// requires the GraphQL minimizeComment mutation), so it falls back to
+// rewriting the body to make it obvious the finding no longer applies.
+// Resolve is idempotent: if posted was already resolved on a previous run,
+// it is left untouched instead of nesting another strikethrough.
+func (g *GitHubPullRequest) Resolve(ctx context.Context, posted reporter.PostedComment) error {
+	body, key, ok := reporter.Unmark(posted.Body)
+	if strings.HasPrefix(body, resolvedBodyPrefix) {
 		return nil
 	}
-	// TODO(haya14busa): it might be useful to report overview results by "body"
-	// field.
-	review := &github.PullRequestReviewRequest{
-		CommitID: &g.sha,
-		Event:    github.String("COMMENT"),
-		Comments: comments[:min(maxCommentsPerRequest, len(comments))],
-	}
-	_, _, err := g.cli.PullRequests.CreateReview(ctx, g.owner, g.repo, g.pr, review)
+	id, err := strconv.ParseInt(posted.ID, 10, 64)
 	if err != nil {
-		return err
-	}
-	// Post reamaining comments after sleeping 2**cnt secs to avoid rate limit.
-	//
-	// > 403 You have triggered an abuse detection mechanism and have been
-	// > temporarily blocked from content creation. Please retry your request
-	// > again later.
-	// https://developer.github.com/v3/#abuse-rate-limits
-	if len(comments) > maxCommentsPerRequest {
-		cnt++
-		sec := int(math.Pow(float64(2), float64(cnt)))
-		log.Printf("reviewdog: too many comments to posts. waiting %d secs to posts remaining %d comments",
-			sec, len(comments)-maxCommentsPerRequest)
-		time.Sleep(time.Duration(sec) * time.Second)
-		return g.postGitHubComments(ctx, comments[maxCommentsPerRequest:], cnt)
+		return fmt.Errorf("invalid GitHub review comment id %q: %v", posted.ID, err)
 	}
-	return nil
+	resolvedBody := fmt.Sprintf("%s%s~~\n\n(no longer reported by reviewdog)", resolvedBodyPrefix, body)
+	if ok {
+		// Keep the fingerprint so that if this finding reappears on a later
+		// run it is recognized as reviewdog's own and updated in place
+		// instead of posted as a fresh duplicate.
+		resolvedBody = reporter.MarkKey(resolvedBody, key)
+	}
+	_, _, err = g.cli.PullRequests.EditComment(ctx, g.owner, g.repo, id, &github.PullRequestComment{Body: &resolvedBody})
+	return err
 }
 
-func (g *GitHubPullRequest) setPostedComment(ctx context.Context) error {
-	g.postedcs = make(serviceutil.PostedComments)
-	cs, err := g.comment(ctx)
-	if err != nil {
-		return err
-	}
-	for _, c := range cs {
-		if c.Position == nil || c.Path == nil || c.Body == nil {
-			// skip resolved comments. Or comments which do not have "path" nor
-			// "body".
-			continue
+// ratelimitKey identifies g's repository for the purpose of pacing
+// review-creating API calls.
+func (g *GitHubPullRequest) ratelimitKey() string {
+	return g.owner + "/" + g.repo
+}
+
+// minAbuseRetryBackoff and maxAbuseRetryAttempts bound the reactive retry on
+// a TooManyRequestsError that carries neither a Retry-After header nor a
+// Rate.Remaining of 0 (GitHub's abuse/secondary-rate-limit 403s frequently
+// carry neither). Without a floor here, ShrinkFromHeaders has nothing to
+// shrink and the retry would busy-loop against the same 403 instead of
+// backing off.
+const (
+	minAbuseRetryBackoff  = 5 * time.Second
+	maxAbuseRetryAttempts = 8
+)
+
+func (g *GitHubPullRequest) postGitHubComments(ctx context.Context, comments []*github.DraftReviewComment) error {
+	attempt := 0
+	for len(comments) > 0 {
+		n := commentsPerReview
+		if n > len(comments) {
+			n = len(comments)
+		}
+		if err := g.limiter.Wait(ctx, g.ratelimitKey()); err != nil {
+			return err
+		}
+		// TODO(haya14busa): it might be useful to report overview results by
+		// "body" field.
+		review := &github.PullRequestReviewRequest{
+			CommitID: &g.sha,
+			Event:    github.String("COMMENT"),
+			Comments: comments[:n],
 		}
-		g.postedcs.AddPostedComment(c.GetPath(), c.GetPosition(), c.GetBody())
+		_, resp, err := g.cli.PullRequests.CreateReview(ctx, g.owner, g.repo, g.pr, review)
+		if resp != nil {
+			g.limiter.ShrinkFromHeaders(g.ratelimitKey(), resp.Rate.Remaining, retryAfter(resp.Response))
+		}
+		if err != nil {
+			if _, ok := rdferrors.FromGitHubError(err).(*rdferrors.TooManyRequestsError); ok {
+				// > 403 You have triggered an abuse detection mechanism and
+				// > have been temporarily blocked from content creation.
+				// > Please retry your request again later.
+				// https://developer.github.com/v3/#abuse-rate-limits
+				attempt++
+				if attempt > maxAbuseRetryAttempts {
+					return fmt.Errorf("reviewdog: giving up posting review comments after %d abuse-detection retries: %w", attempt-1, err)
+				}
+				backoff := minAbuseRetryBackoff * time.Duration(attempt)
+				log.Printf("reviewdog: rate limited posting review comments, waiting %s before retrying (attempt %d/%d)",
+					backoff, attempt, maxAbuseRetryAttempts)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(backoff):
+				}
+				continue
+			}
+			return rdferrors.FromGitHubError(err)
+		}
+		attempt = 0
+		comments = comments[n:]
 	}
 	return nil
 }
 
+// retryAfter parses the Retry-After header of resp, if any.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	var secs int
+	if _, err := fmt.Sscanf(v, "%d", &secs); err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
 // Diff returns a diff of PullRequest.
 func (g *GitHubPullRequest) Diff(ctx context.Context) ([]byte, error) {
 	opt := github.RawOptions{Type: github.Diff}
@@ -226,10 +356,3 @@ func listAllPullRequestsComments(ctx context.Context, cli *github.Client,
 	}
 	return append(comments, restComments...), nil
 }
-
-func min(x, y int) int {
-	if x > y {
-		return y
-	}
-	return x
-}
@@ -0,0 +1,175 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/go-github/v28/github"
+	"github.com/reviewdog/reviewdog"
+	"github.com/reviewdog/reviewdog/service/serviceutil"
+)
+
+var _ reviewdog.CommentService = &GitHubPullRequestCheck{}
+var _ reviewdog.DiffService = &GitHubPullRequestCheck{}
+
+// maxAnnotationsPerUpdate is the number of annotations the Checks API
+// accepts per UpdateCheckRun call. A check run may carry an unlimited number
+// of annotations in total across repeated calls, while pull request review
+// comments go out commentsPerReview at a time, paced by ratelimit.Limiter.
+// https://developer.github.com/v3/checks/runs/#update-a-check-run
+const maxAnnotationsPerUpdate = 50
+
+// GitHubPullRequestCheck is a comment and diff service for GitHub PullRequest
+// that reports findings as Check Run annotations instead of pull request
+// review comments. It requires a token with Checks API access (i.e. a
+// GitHub App installation token), and uploads annotations in chunks of
+// maxAnnotationsPerUpdate via repeated UpdateCheckRun calls so that large
+// lint runs aren't capped by GitHub's review-comment abuse rate limit.
+type GitHubPullRequestCheck struct {
+	cli   *github.Client
+	owner string
+	repo  string
+	pr    int
+	sha   string
+	name  string
+
+	// checkID is lazily populated by ensureCheckRun on the first Flush, so
+	// that an instance supplied only as a conditional
+	// WithCheckAnnotationsFallback and never actually flushed doesn't leave
+	// a check run permanently stuck "in_progress" on the PR.
+	muCheckID sync.Mutex
+	checkID   int64
+
+	muComments   sync.Mutex
+	postComments []*reviewdog.Comment
+
+	// wd is working directory relative to root of repository.
+	wd string
+}
+
+// NewGitHubPullRequestCheck returns a new GitHubPullRequestCheck service. The
+// check run itself is created lazily, on the first Flush, so that an
+// instance which is never flushed doesn't create one at all.
+func NewGitHubPullRequestCheck(ctx context.Context, cli *github.Client, owner, repo, name string, pr int, sha string) (*GitHubPullRequestCheck, error) {
+	workDir, err := serviceutil.GitRelWorkdir(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("GitHubPullRequestCheck needs 'git' command: %v", err)
+	}
+	return &GitHubPullRequestCheck{
+		cli:   cli,
+		owner: owner,
+		repo:  repo,
+		pr:    pr,
+		sha:   sha,
+		name:  name,
+		wd:    workDir,
+	}, nil
+}
+
+// ensureCheckRun creates the in-progress check run on first use and returns
+// its ID, so a GitHubPullRequestCheck that is never flushed never creates
+// one. A Flush with no held comments still creates it.
+func (g *GitHubPullRequestCheck) ensureCheckRun(ctx context.Context) (int64, error) {
+	g.muCheckID.Lock()
+	defer g.muCheckID.Unlock()
+	if g.checkID != 0 {
+		return g.checkID, nil
+	}
+	run, _, err := g.cli.Checks.CreateCheckRun(ctx, g.owner, g.repo, github.CreateCheckRunOptions{
+		Name:    g.name,
+		HeadSHA: g.sha,
+		Status:  github.String("in_progress"),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create check run: %v", err)
+	}
+	g.checkID = run.GetID()
+	return g.checkID, nil
+}
+
+// Post accepts a comment and holds it. Flush method actually uploads the
+// annotations to GitHub.
+func (g *GitHubPullRequestCheck) Post(_ context.Context, c *reviewdog.Comment) error {
+	c.Path = filepath.ToSlash(filepath.Join(g.wd, c.Path))
+	g.postNormalized(c)
+	return nil
+}
+
+// postNormalized holds a comment whose Path is already relative to the
+// repository root, skipping Post's own path rewrite. It exists so that
+// callers which already normalized Path themselves (e.g. GitHubPullRequest
+// falling back to check-run annotations) don't join g.wd in twice.
+func (g *GitHubPullRequestCheck) postNormalized(c *reviewdog.Comment) {
+	g.muComments.Lock()
+	defer g.muComments.Unlock()
+	g.postComments = append(g.postComments, c)
+}
+
+// Flush uploads every held comment as a Check Run annotation, chunked by
+// maxAnnotationsPerUpdate, and completes the check run.
+func (g *GitHubPullRequestCheck) Flush(ctx context.Context) error {
+	checkID, err := g.ensureCheckRun(ctx)
+	if err != nil {
+		return err
+	}
+
+	g.muComments.Lock()
+	defer g.muComments.Unlock()
+
+	annotations := make([]*github.CheckRunAnnotation, 0, len(g.postComments))
+	for _, c := range g.postComments {
+		cbody := serviceutil.CommentBody(c)
+		annotations = append(annotations, &github.CheckRunAnnotation{
+			Path:            &c.Path,
+			StartLine:       &c.CheckResult.Lnum,
+			EndLine:         &c.CheckResult.Lnum,
+			AnnotationLevel: github.String("warning"),
+			Message:         &cbody,
+			Title:           github.String(fmt.Sprintf("[%s] %s#L%d", c.ToolName, c.Path, c.CheckResult.Lnum)),
+		})
+	}
+	for len(annotations) > 0 {
+		n := maxAnnotationsPerUpdate
+		if n > len(annotations) {
+			n = len(annotations)
+		}
+		if _, _, err := g.cli.Checks.UpdateCheckRun(ctx, g.owner, g.repo, checkID, github.UpdateCheckRunOptions{
+			Name: g.name,
+			Output: &github.CheckRunOutput{
+				Title:       github.String(g.name),
+				Summary:     github.String(fmt.Sprintf("reported %d finding(s)", len(g.postComments))),
+				Annotations: annotations[:n],
+			},
+		}); err != nil {
+			return fmt.Errorf("failed to upload check run annotations: %v", err)
+		}
+		annotations = annotations[n:]
+	}
+	conclusion := "success"
+	if len(g.postComments) > 0 {
+		conclusion = "neutral"
+	}
+	_, _, err = g.cli.Checks.UpdateCheckRun(ctx, g.owner, g.repo, checkID, github.UpdateCheckRunOptions{
+		Name:       g.name,
+		Status:     github.String("completed"),
+		Conclusion: github.String(conclusion),
+	})
+	return err
+}
+
+// Diff returns a diff of PullRequest.
+func (g *GitHubPullRequestCheck) Diff(ctx context.Context) ([]byte, error) {
+	opt := github.RawOptions{Type: github.Diff}
+	d, _, err := g.cli.PullRequests.GetRaw(ctx, g.owner, g.repo, g.pr, opt)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(d), nil
+}
+
+// Strip returns 1 as a strip of git diff.
+func (g *GitHubPullRequestCheck) Strip() int {
+	return 1
+}
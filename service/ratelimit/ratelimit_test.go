@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Wait_allowsUpToLimit(t *testing.T) {
+	l := NewLimiter(3, time.Minute)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		done := make(chan error, 1)
+		go func() { done <- l.Wait(ctx, "o/r") }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Wait() error = %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Wait() call %d blocked, want immediate return within the limit", i)
+		}
+	}
+}
+
+func TestLimiter_Wait_blocksOverLimit(t *testing.T) {
+	l := NewLimiter(1, 50*time.Millisecond)
+	ctx := context.Background()
+	if err := l.Wait(ctx, "o/r"); err != nil {
+		t.Fatalf("first Wait() error = %v", err)
+	}
+
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx2, "o/r"); err == nil {
+		t.Fatal("second Wait() within the window succeeded, want it to block past the short-lived context")
+	}
+
+	// After the window elapses it should succeed again.
+	if err := l.Wait(ctx, "o/r"); err != nil {
+		t.Fatalf("Wait() after window elapsed, error = %v", err)
+	}
+}
+
+func TestLimiter_Wait_perKey(t *testing.T) {
+	l := NewLimiter(1, time.Minute)
+	ctx := context.Background()
+	if err := l.Wait(ctx, "a"); err != nil {
+		t.Fatalf("Wait(a) error = %v", err)
+	}
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx2, "b"); err != nil {
+		t.Fatalf("Wait(b) should not be blocked by key a's window, error = %v", err)
+	}
+}
+
+func TestLimiter_ShrinkFromHeaders_retryAfter(t *testing.T) {
+	l := NewLimiter(1, time.Minute)
+	l.ShrinkFromHeaders("o/r", 10, 50*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, "o/r"); err == nil {
+		t.Fatal("Wait() succeeded immediately after a Retry-After shrink, want it to block")
+	}
+}
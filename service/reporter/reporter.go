@@ -0,0 +1,192 @@
+// Package reporter implements cross-run reconciliation of comments posted by
+// reviewdog to a code review service (GitHub pull requests, GitLab merge
+// requests, ...).
+//
+// Each service-specific adapter (e.g. service/github.GitHubPullRequest) only
+// needs to implement CommentReporter; Apply takes care of deciding, for each
+// comment reviewdog wants to report, whether it should be created, skipped
+// because it is already posted verbatim, updated because the same finding's
+// body changed, or resolved because reviewdog produced it on a previous run
+// but no longer does.
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Comment is the minimal view of a finding reviewdog wants to report that
+// CommentReporter needs in order to reconcile it against what is already
+// posted.
+type Comment struct {
+	// ToolName is the name of the tool that produced the comment.
+	ToolName string
+	// Path is the path of the file the comment is attached to.
+	Path string
+	// Line is the 1-based line of the comment, e.g. the diff position on
+	// GitHub or the line number on GitLab.
+	Line int
+	// Body is the rendered comment body, without any reviewdog fingerprint.
+	Body string
+}
+
+// PostedComment is a comment reviewdog posted on a previous run, as reported
+// back by the review service.
+type PostedComment struct {
+	// ID is the service-specific comment identifier, e.g. a GitHub review
+	// comment ID. It is opaque to this package and only round-tripped back
+	// to the CommentReporter that produced it.
+	ID string
+	// Body is the comment body exactly as stored by the service, including
+	// the reviewdog fingerprint marker if any.
+	Body string
+}
+
+const fingerprintPrefix = "<!-- reviewdog-fingerprint:"
+
+// identityKey is the part of a Comment's fingerprint that is stable across
+// edits to its body: the tool that produced it and where it was attached.
+func identityKey(c Comment) string {
+	return fmt.Sprintf("%s:%s:%d", c.ToolName, c.Path, c.Line)
+}
+
+// Mark appends a hidden fingerprint marker to c.Body so that a later
+// reviewdog run can recognize the posted comment as its own and recover the
+// (tool, path, line) it was generated for, without needing any local state.
+func Mark(c Comment) string {
+	return MarkKey(c.Body, identityKey(c))
+}
+
+// MarkKey appends a hidden fingerprint marker for key to body. It is Mark's
+// underlying primitive; call it directly when only the identity key is at
+// hand, e.g. one recovered via Unmark while rewriting a resolved comment so
+// it is still recognized as reviewdog's on the next run.
+func MarkKey(body, key string) string {
+	return fmt.Sprintf("%s\n\n%s%s -->", body, fingerprintPrefix, key)
+}
+
+var fingerprintRe = regexp.MustCompile(regexp.QuoteMeta(fingerprintPrefix) + `(.+?) -->`)
+
+// Unmark strips the fingerprint marker from a previously posted body and
+// returns the remaining body along with the identity key it was marked
+// with. ok is false if body does not carry a reviewdog fingerprint, in which
+// case the comment was not posted by reviewdog and must be left alone.
+func Unmark(body string) (remaining, key string, ok bool) {
+	m := fingerprintRe.FindStringSubmatchIndex(body)
+	if m == nil {
+		return body, "", false
+	}
+	key = body[m[2]:m[3]]
+	remaining = strings.TrimRight(body[:m[0]], "\n")
+	return remaining, key, true
+}
+
+// Action is the reconciliation decision for a single desired Comment.
+type Action int
+
+const (
+	// ActionCreate means the comment has not been posted before.
+	ActionCreate Action = iota
+	// ActionSkip means an identical comment is already posted.
+	ActionSkip
+	// ActionUpdate means a comment for the same finding is already posted,
+	// but its body changed since the last run.
+	ActionUpdate
+)
+
+// Diff is one reconciliation step produced by Reconcile.
+type Diff struct {
+	Action  Action
+	Comment Comment
+	// Posted is set when Action is ActionUpdate or ActionSkip.
+	Posted *PostedComment
+}
+
+// Reconcile compares desired against posted, the comments already fetched
+// from the PR/MR, and returns the Diffs to apply plus the posted comments
+// that no longer correspond to any desired comment and should be resolved.
+func Reconcile(desired []Comment, posted []PostedComment) (diffs []Diff, resolve []PostedComment) {
+	byKey := make(map[string]PostedComment, len(posted))
+	for _, p := range posted {
+		if _, key, ok := Unmark(p.Body); ok {
+			byKey[key] = p
+		}
+	}
+	seen := make(map[string]bool, len(desired))
+	for _, c := range desired {
+		key := identityKey(c)
+		seen[key] = true
+		p, ok := byKey[key]
+		if !ok {
+			diffs = append(diffs, Diff{Action: ActionCreate, Comment: c})
+			continue
+		}
+		existingBody, _, _ := Unmark(p.Body)
+		if existingBody == c.Body {
+			diffs = append(diffs, Diff{Action: ActionSkip, Comment: c, Posted: &p})
+			continue
+		}
+		diffs = append(diffs, Diff{Action: ActionUpdate, Comment: c, Posted: &p})
+	}
+	for key, p := range byKey {
+		if !seen[key] {
+			resolve = append(resolve, p)
+		}
+	}
+	return diffs, resolve
+}
+
+// CommentReporter is implemented by services that can reconcile a set of
+// desired comments against what reviewdog posted on a previous run. Of the
+// services, only service/github.GitHubPullRequest implements it;
+// service/github.GitHubPullRequestCheck and the GitLab services do not.
+type CommentReporter interface {
+	// Existing returns the comments reviewdog has posted on a previous run.
+	Existing(ctx context.Context) ([]PostedComment, error)
+	// Create posts comments that have not been posted before. Implementations
+	// are free to batch these into as few requests as the underlying API
+	// allows.
+	Create(ctx context.Context, cs []Comment) error
+	// Update edits a previously posted comment in place because the finding
+	// it represents changed.
+	Update(ctx context.Context, posted PostedComment, c Comment) error
+	// Resolve marks a previously posted comment as no longer applicable,
+	// e.g. by minimizing, resolving or rewriting it.
+	Resolve(ctx context.Context, posted PostedComment) error
+}
+
+// Apply reconciles desired against r.Existing and drives
+// Create/Update/Resolve so that, once it returns, the comments posted on the
+// PR/MR reflect desired without accumulating stale comments across runs.
+func Apply(ctx context.Context, r CommentReporter, desired []Comment) error {
+	posted, err := r.Existing(ctx)
+	if err != nil {
+		return err
+	}
+	diffs, resolve := Reconcile(desired, posted)
+
+	var creates []Comment
+	for _, d := range diffs {
+		switch d.Action {
+		case ActionCreate:
+			creates = append(creates, d.Comment)
+		case ActionUpdate:
+			if err := r.Update(ctx, *d.Posted, d.Comment); err != nil {
+				return err
+			}
+		}
+	}
+	if len(creates) > 0 {
+		if err := r.Create(ctx, creates); err != nil {
+			return err
+		}
+	}
+	for _, p := range resolve {
+		if err := r.Resolve(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package reporter
+
+import (
+	"testing"
+)
+
+func TestMarkUnmark(t *testing.T) {
+	c := Comment{ToolName: "golint", Path: "main.go", Line: 14, Body: "exported function Foo should have comment"}
+	marked := Mark(c)
+	body, key, ok := Unmark(marked)
+	if !ok {
+		t.Fatalf("Unmark(%q) ok = false, want true", marked)
+	}
+	if body != c.Body {
+		t.Errorf("Unmark body = %q, want %q", body, c.Body)
+	}
+	if want := identityKey(c); key != want {
+		t.Errorf("Unmark key = %q, want %q", key, want)
+	}
+}
+
+func TestUnmark_NotReviewdog(t *testing.T) {
+	if _, _, ok := Unmark("just a regular comment"); ok {
+		t.Error("Unmark ok = true for a comment without a fingerprint, want false")
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	stale := PostedComment{ID: "1", Body: Mark(Comment{ToolName: "golint", Path: "old.go", Line: 1, Body: "stale finding"})}
+	unchanged := Comment{ToolName: "golint", Path: "main.go", Line: 10, Body: "same finding"}
+	changed := Comment{ToolName: "golint", Path: "main.go", Line: 20, Body: "new body"}
+	changedPosted := PostedComment{ID: "2", Body: Mark(Comment{ToolName: "golint", Path: "main.go", Line: 20, Body: "old body"})}
+	brandNew := Comment{ToolName: "golint", Path: "main.go", Line: 30, Body: "brand new finding"}
+	notOurs := PostedComment{ID: "3", Body: "a human's comment"}
+
+	desired := []Comment{unchanged, changed, brandNew}
+	posted := []PostedComment{
+		stale,
+		{ID: "4", Body: Mark(unchanged)},
+		changedPosted,
+		notOurs,
+	}
+
+	diffs, resolve := Reconcile(desired, posted)
+
+	var creates, updates, skips int
+	for _, d := range diffs {
+		switch d.Action {
+		case ActionCreate:
+			creates++
+			if d.Comment != brandNew {
+				t.Errorf("ActionCreate comment = %+v, want %+v", d.Comment, brandNew)
+			}
+		case ActionUpdate:
+			updates++
+			if d.Comment != changed {
+				t.Errorf("ActionUpdate comment = %+v, want %+v", d.Comment, changed)
+			}
+		case ActionSkip:
+			skips++
+		}
+	}
+	if creates != 1 || updates != 1 || skips != 1 {
+		t.Fatalf("got creates=%d updates=%d skips=%d, want 1/1/1", creates, updates, skips)
+	}
+	if len(resolve) != 1 || resolve[0].ID != stale.ID {
+		t.Errorf("resolve = %+v, want only %+v", resolve, stale)
+	}
+}
@@ -0,0 +1,39 @@
+// Package serviceutil provides small helpers shared by the comment and diff
+// services under service/.
+package serviceutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/reviewdog/reviewdog"
+)
+
+// GitRelWorkdir returns a path relative to the root of the git repository
+// for the current working directory, e.g. "cmd/reviewdog". It shells out to
+// `git rev-parse --show-prefix`, so ctx is honored: cancelling it (CI job
+// timeout, SIGINT) terminates the underlying git process instead of
+// blocking the caller.
+func GitRelWorkdir(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--show-prefix")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run `git rev-parse --show-prefix`: %v", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// CommentBody builds the Markdown body reviewdog posts for a single
+// comment, attributing it to the tool that produced it.
+func CommentBody(c *reviewdog.Comment) string {
+	var b bytes.Buffer
+	if c.ToolName != "" {
+		fmt.Fprintf(&b, "**[%s]** ", c.ToolName)
+	}
+	b.WriteString(c.CheckResult.Message)
+	fmt.Fprint(&b, "\n\n<sub>reported by [reviewdog](https://github.com/reviewdog/reviewdog) :dog:</sub>")
+	return b.String()
+}